@@ -0,0 +1,117 @@
+package net
+
+import (
+	"encoding/json"
+)
+
+type NetIOCountersStat struct {
+	Name        string `json:"name"`        // interface name
+	BytesSent   uint64 `json:"bytesSent"`   // number of bytes sent
+	BytesRecv   uint64 `json:"bytesRecv"`   // number of bytes received
+	PacketsSent uint64 `json:"packetsSent"` // number of packets sent
+	PacketsRecv uint64 `json:"packetsRecv"` // number of packets received
+	Errin       uint64 `json:"errin"`       // total number of errors while receiving
+	Errout      uint64 `json:"errout"`      // total number of errors while sending
+	Dropin      uint64 `json:"dropin"`      // total number of incoming packets which were dropped
+	Dropout     uint64 `json:"dropout"`     // total number of outgoing packets which were dropped (always 0 on OSX and BSD)
+	Fifoin      uint64 `json:"fifoin"`      // total number of FIFO buffers errors while receiving
+	Fifoout     uint64 `json:"fifoout"`     // total number of FIFO buffers errors while sending
+}
+
+type NetConnectionStat struct {
+	Fd     uint32 `json:"fd"`
+	Family uint32 `json:"family"`
+	Type   uint32 `json:"type"`
+	Laddr  Addr   `json:"localaddr"`
+	Raddr  Addr   `json:"remoteaddr"`
+	// Laddrs and Raddrs carry the full multi-homed address list for
+	// protocols that support more than one local/remote address per
+	// association, e.g. SCTP. Laddr/Raddr are set to the first entry of
+	// each for callers that only care about a single address. Both are
+	// nil for all other kinds, which carry one address per connection.
+	Laddrs []Addr `json:"localaddrs,omitempty"`
+	Raddrs []Addr `json:"remoteaddrs,omitempty"`
+	Status string `json:"status"`
+	Pid    int32  `json:"pid"`
+	// PeerInode is the socket inode of the connected peer for AF_UNIX
+	// sockets, as reported by UNIX_DIAG's UDIAG_SHOW_PEER. It is zero for
+	// connections gathered from /proc/net/unix or for non-UNIX sockets.
+	PeerInode uint32 `json:"peerInode"`
+
+	// Comm/Exe are the owning process's /proc/<pid>/comm and
+	// /proc/<pid>/exe, empty if the owning process could not be
+	// determined. For TCP, UDP, raw and UNIX sockets read from procfs, and
+	// for UNIX sockets read via sock_diag, UID is the owning process's real
+	// UID, or -1 if that process could not be determined. For SCTP and
+	// packet sockets, and for TCP/UDP sockets read via sock_diag, UID is
+	// the socket's UID as reported by the kernel.
+	UID  int32  `json:"uid"`
+	Comm string `json:"comm"`
+	Exe  string `json:"exe"`
+
+	// PeerPid and PeerUID identify the process on the other end of an
+	// AF_UNIX connection, resolved via PeerInode. PeerPid is zero and
+	// PeerUID is -1 when the peer isn't connected or couldn't be
+	// resolved.
+	PeerPid int32 `json:"peerPid"`
+	PeerUID int32 `json:"peerUid"`
+}
+
+type Addr struct {
+	IP   string `json:"ip"`
+	Port uint32 `json:"port"`
+}
+
+type NetProtoCountersStat struct {
+	Protocol string           `json:"protocol"`
+	Stats    map[string]int64 `json:"stats"`
+}
+
+// NetFilterStat is a conntrack statistics for Linux
+type NetFilterStat struct {
+	ConnTrackCount int64 `json:"connTrackCount"`
+	ConnTrackMax   int64 `json:"connTrackMax"`
+}
+
+func (n NetIOCountersStat) String() string {
+	s, _ := json.Marshal(n)
+	return string(s)
+}
+
+func (n NetConnectionStat) String() string {
+	s, _ := json.Marshal(n)
+	return string(s)
+}
+
+func (a Addr) String() string {
+	s, _ := json.Marshal(a)
+	return string(s)
+}
+
+func (n NetProtoCountersStat) String() string {
+	s, _ := json.Marshal(n)
+	return string(s)
+}
+
+func (n NetFilterStat) String() string {
+	s, _ := json.Marshal(n)
+	return string(s)
+}
+
+func getNetIOCountersAll(n []NetIOCountersStat) ([]NetIOCountersStat, error) {
+	r := NetIOCountersStat{
+		Name: "all",
+	}
+	for _, nic := range n {
+		r.BytesRecv += nic.BytesRecv
+		r.PacketsRecv += nic.PacketsRecv
+		r.Errin += nic.Errin
+		r.Dropin += nic.Dropin
+		r.BytesSent += nic.BytesSent
+		r.PacketsSent += nic.PacketsSent
+		r.Errout += nic.Errout
+		r.Dropout += nic.Dropout
+	}
+
+	return []NetIOCountersStat{r}, nil
+}
@@ -115,6 +115,8 @@ var netProtocols = []string{
 // just the protocols in the list are returned.
 // Available protocols:
 //   ip,icmp,icmpmsg,tcp,udp,udplite
+// See NetProtoCountersExtended for the TcpExt/IpExt/IPv6 counters that
+// /proc/net/snmp does not carry.
 func NetProtoCounters(protocols []string) ([]NetProtoCountersStat, error) {
 	if len(protocols) == 0 {
 		protocols = netProtocols
@@ -171,6 +173,168 @@ func NetProtoCounters(protocols []string) ([]NetProtoCountersStat, error) {
 	return stats, nil
 }
 
+// netProtocolsExtended lists the protocol groups returned by
+// NetProtoCountersExtended, on top of those already available from
+// NetProtoCounters.
+var netProtocolsExtended = []string{
+	"tcp_ext",
+	"ip_ext",
+	"ip6",
+	"icmp6",
+	"udp6",
+}
+
+// netstatGroupNames maps the group tag as it appears in /proc/net/netstat
+// (lowercased) to the protocol name gopsutil exposes it under.
+var netstatGroupNames = map[string]string{
+	"tcpext": "tcp_ext",
+	"ipext":  "ip_ext",
+}
+
+// snmp6Prefixes maps the key prefix used in /proc/net/snmp6 to the
+// protocol name gopsutil exposes it under. None of these prefixes is a
+// prefix of another; UdpLite6 keys match none of them and are skipped.
+var snmp6Prefixes = []struct {
+	prefix   string
+	protocol string
+}{
+	{"Icmp6", "icmp6"},
+	{"Udp6", "udp6"},
+	{"Ip6", "ip6"},
+}
+
+// NetProtoCountersExtended returns the counter groups that NetProtoCounters
+// does not cover: TcpExt/IpExt from /proc/net/netstat, and the IPv6/ICMPv6
+// counters from /proc/net/snmp6. Unlike /proc/net/snmp, /proc/net/snmp6
+// has one "Key Value" pair per line instead of a header/data line per
+// group, so it needs its own parser.
+// If protocols is empty then all of netProtocolsExtended are returned,
+// otherwise just the protocols in the list are returned.
+// Available protocols:
+//   tcp_ext,ip_ext,ip6,icmp6,udp6
+func NetProtoCountersExtended(protocols []string) ([]NetProtoCountersStat, error) {
+	if len(protocols) == 0 {
+		protocols = netProtocolsExtended
+	}
+	protos := make(map[string]bool, len(protocols))
+	for _, p := range protocols {
+		protos[p] = true
+	}
+
+	stats := make([]NetProtoCountersStat, 0, len(protocols))
+
+	netstatStats, err := parseNetstatFile(common.HostProc("net/netstat"), protos)
+	if err != nil {
+		return nil, err
+	}
+	stats = append(stats, netstatStats...)
+
+	snmp6Stats, err := parseSNMP6File(common.HostProc("net/snmp6"), protos)
+	if err != nil {
+		return nil, err
+	}
+	stats = append(stats, snmp6Stats...)
+
+	return stats, nil
+}
+
+// parseNetstatFile parses /proc/net/netstat, which shares the
+// header-line/data-line-per-group layout of /proc/net/snmp but groups its
+// counters under TcpExt/IpExt instead of Tcp/Ip/etc.
+func parseNetstatFile(filename string, protos map[string]bool) ([]NetProtoCountersStat, error) {
+	lines, err := common.ReadLines(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []NetProtoCountersStat
+	linecount := len(lines)
+	for i := 0; i < linecount; i++ {
+		line := lines[i]
+		r := strings.IndexRune(line, ':')
+		if r == -1 {
+			return nil, errors.New(filename + " is not fomatted correctly, expected ':'.")
+		}
+		group := strings.ToLower(line[:r])
+		proto, ok := netstatGroupNames[group]
+		if !ok || !protos[proto] {
+			// skip group and data line
+			i++
+			continue
+		}
+
+		statNames := strings.Split(line[r+2:], " ")
+
+		i++
+		statValues := strings.Split(lines[i][r+2:], " ")
+		if len(statNames) != len(statValues) {
+			return nil, errors.New(filename + " is not fomatted correctly, expected same number of columns.")
+		}
+		stat := NetProtoCountersStat{
+			Protocol: proto,
+			Stats:    make(map[string]int64, len(statNames)),
+		}
+		for j := range statNames {
+			value, err := strconv.ParseInt(statValues[j], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			stat.Stats[statNames[j]] = value
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// parseSNMP6File parses /proc/net/snmp6, which lists one "Key Value" pair
+// per line instead of grouping stats under a header/data line pair.
+func parseSNMP6File(filename string, protos map[string]bool) ([]NetProtoCountersStat, error) {
+	lines, err := common.ReadLines(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	byProto := make(map[string]map[string]int64)
+	var order []string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		key, valueStr := fields[0], fields[1]
+
+		proto := ""
+		for _, p := range snmp6Prefixes {
+			if strings.HasPrefix(key, p.prefix) {
+				proto = p.protocol
+				break
+			}
+		}
+		if proto == "" || !protos[proto] {
+			continue
+		}
+
+		value, err := strconv.ParseInt(valueStr, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := byProto[proto]; !exists {
+			byProto[proto] = make(map[string]int64)
+			order = append(order, proto)
+		}
+		byProto[proto][key] = value
+	}
+
+	stats := make([]NetProtoCountersStat, 0, len(order))
+	for _, proto := range order {
+		stats = append(stats, NetProtoCountersStat{
+			Protocol: proto,
+			Stats:    byProto[proto],
+		})
+	}
+	return stats, nil
+}
+
 // NetFilterCounters returns iptables conntrack statistics
 // the currently in use conntrack count and the max.
 // If the file does not exist or is invalid it will return nil.
@@ -265,15 +429,23 @@ type inodeMap struct {
 }
 
 type connTmp struct {
-	fd       uint32
-	family   uint32
-	sockType uint32
-	laddr    Addr
-	raddr    Addr
-	status   string
-	pid      int32
-	boundPid int32
-	path     string
+	fd        uint32
+	family    uint32
+	sockType  uint32
+	laddr     Addr
+	raddr     Addr
+	laddrs    []Addr
+	raddrs    []Addr
+	status    string
+	pid       int32
+	boundPid  int32
+	path      string
+	peerInode uint32
+	uid       int32
+	comm      string
+	exe       string
+	peerPid   int32
+	peerUID   int32
 }
 
 // Return a list of network connections opened.
@@ -284,6 +456,10 @@ func NetConnections(kind string) ([]NetConnectionStat, error) {
 // Return a list of network connections opened by a process.
 func NetConnectionsPid(kind string, pid int32) ([]NetConnectionStat, error) {
 	tmap, ok := netConnectionKindMap[kind]
+	if kind == "all" && IncludeExtendedKindsInAll {
+		tmap = allKindsExtended
+		ok = true
+	}
 	if !ok {
 		return nil, fmt.Errorf("invalid kind, %s", kind)
 	}
@@ -305,31 +481,42 @@ func NetConnectionsPid(kind string, pid int32) ([]NetConnectionStat, error) {
 
 	dupCheckMap := make(map[string]bool)
 	var ret []NetConnectionStat
+	owners := make(procOwnerCache)
 
 	for _, t := range tmap {
 		var path string
 		var ls []connTmp
 		path = fmt.Sprintf("%s/net/%s", root, t.filename)
-		switch t.family {
-		case syscall.AF_INET:
-			fallthrough
-		case syscall.AF_INET6:
-			ls, err = processInet(path, t, inodes, pid)
-		case syscall.AF_UNIX:
-			ls, err = processUnix(path, t, inodes, pid)
+		switch {
+		case strings.HasPrefix(t.filename, "sctp/"):
+			ls, err = processSCTP(path, t, inodes, pid, owners)
+		case t.family == syscall.AF_PACKET:
+			ls, err = processPacket(path, t, inodes, pid, owners)
+		case t.family == syscall.AF_INET, t.family == syscall.AF_INET6:
+			ls, err = processInet(path, t, inodes, pid, owners)
+		case t.family == syscall.AF_UNIX:
+			ls, err = processUnix(path, t, inodes, pid, owners)
 		}
 		if err != nil {
 			return nil, err
 		}
 		for _, c := range ls {
 			conn := NetConnectionStat{
-				Fd:     c.fd,
-				Family: c.family,
-				Type:   c.sockType,
-				Laddr:  c.laddr,
-				Raddr:  c.raddr,
-				Status: c.status,
-				Pid:    c.pid,
+				Fd:        c.fd,
+				Family:    c.family,
+				Type:      c.sockType,
+				Laddr:     c.laddr,
+				Raddr:     c.raddr,
+				Laddrs:    c.laddrs,
+				Raddrs:    c.raddrs,
+				Status:    c.status,
+				Pid:       c.pid,
+				PeerInode: c.peerInode,
+				UID:       c.uid,
+				Comm:      c.comm,
+				Exe:       c.exe,
+				PeerPid:   c.peerPid,
+				PeerUID:   c.peerUID,
 			}
 			if c.pid == 0 {
 				conn.Pid = c.boundPid
@@ -496,7 +683,64 @@ func parseIPv6HexString(src []byte) (net.IP, error) {
 	return net.IP(buf), nil
 }
 
-func processInet(file string, kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32) ([]connTmp, error) {
+// procOwnerInfo reads the owning process's real UID from
+// /proc/<pid>/status and its command/executable path from
+// /proc/<pid>/comm and /proc/<pid>/exe. uid is -1 and comm/exe are empty
+// if pid is 0 or the process has already exited.
+func procOwnerInfo(root string, pid int32) (uid int32, comm string, exe string) {
+	uid = -1
+	if pid <= 0 {
+		return uid, comm, exe
+	}
+
+	lines, err := common.ReadLines(fmt.Sprintf("%s/%d/status", root, pid))
+	if err == nil {
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "Uid:") {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				if v, err := strconv.ParseInt(fields[1], 10, 32); err == nil {
+					uid = int32(v)
+				}
+			}
+			break
+		}
+	}
+
+	if b, err := ioutil.ReadFile(fmt.Sprintf("%s/%d/comm", root, pid)); err == nil {
+		comm = strings.TrimSpace(string(b))
+	}
+	if link, err := os.Readlink(fmt.Sprintf("%s/%d/exe", root, pid)); err == nil {
+		exe = link
+	}
+
+	return uid, comm, exe
+}
+
+// procOwner is the cached result of procOwnerInfo for one pid.
+type procOwner struct {
+	uid  int32
+	comm string
+	exe  string
+}
+
+// procOwnerCache memoizes procOwnerInfo by pid so that a process owning
+// many sockets only costs one /proc/<pid>/{status,comm,exe} read instead
+// of one per connection.
+type procOwnerCache map[int32]procOwner
+
+func (c procOwnerCache) get(root string, pid int32) (uid int32, comm string, exe string) {
+	if o, ok := c[pid]; ok {
+		return o.uid, o.comm, o.exe
+	}
+	uid, comm, exe = procOwnerInfo(root, pid)
+	c[pid] = procOwner{uid: uid, comm: comm, exe: exe}
+	return uid, comm, exe
+}
+
+func processInet(file string, kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32, owners procOwnerCache) ([]connTmp, error) {
 
 	if strings.HasSuffix(file, "6") && !common.PathExists(file) {
 		// IPv6 not supported, return empty.
@@ -541,6 +785,8 @@ func processInet(file string, kind netConnectionKindType, inodes map[string][]in
 			continue
 		}
 
+		uid, comm, exe := owners.get(common.HostProc(), pid)
+
 		ret = append(ret, connTmp{
 			fd:       fd,
 			family:   kind.family,
@@ -549,18 +795,27 @@ func processInet(file string, kind netConnectionKindType, inodes map[string][]in
 			raddr:    ra,
 			status:   status,
 			pid:      pid,
+			uid:      uid,
+			comm:     comm,
+			exe:      exe,
 		})
 	}
 
 	return ret, nil
 }
 
-func processUnix(file string, kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32) ([]connTmp, error) {
+func processUnix(file string, kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32, owners procOwnerCache) ([]connTmp, error) {
 	lines, err := common.ReadLines(file)
 	if err != nil {
 		return nil, err
 	}
 
+	// Best-effort: resolve each socket's peer inode via sock_diag so we
+	// can map it back through `inodes` to the peer's pid/uid. Unix_diag
+	// may be unavailable (older kernel, no CONFIG_UNIX_DIAG); in that
+	// case PeerPid/PeerUID are simply left unset.
+	peerInodes, _ := unixDiagPeerInodes()
+
 	var ret []connTmp
 	// skip first line
 	for _, line := range lines[1:] {
@@ -575,6 +830,16 @@ func processUnix(file string, kind netConnectionKindType, inodes map[string][]in
 
 		inode := tokens[6]
 
+		var peerPid, peerUID int32 = 0, -1
+		if inodeNum, err := strconv.ParseUint(inode, 10, 32); err == nil {
+			if peerInode, ok := peerInodes[uint32(inodeNum)]; ok {
+				if peerOwners, ok := inodes[fmt.Sprintf("%d", peerInode)]; ok {
+					peerPid = peerOwners[0].pid
+					peerUID, _, _ = owners.get(common.HostProc(), peerPid)
+				}
+			}
+		}
+
 		var pairs []inodeMap
 		pairs, exists := inodes[inode]
 		if !exists {
@@ -590,6 +855,7 @@ func processUnix(file string, kind netConnectionKindType, inodes map[string][]in
 			if len(tokens) == 8 {
 				path = tokens[len(tokens)-1]
 			}
+			uid, comm, exe := owners.get(common.HostProc(), pair.pid)
 			ret = append(ret, connTmp{
 				fd:       pair.fd,
 				family:   kind.family,
@@ -597,9 +863,14 @@ func processUnix(file string, kind netConnectionKindType, inodes map[string][]in
 				laddr: Addr{
 					IP: path,
 				},
-				pid:    pair.pid,
-				status: "NONE",
-				path:   path,
+				pid:     pair.pid,
+				status:  "NONE",
+				path:    path,
+				uid:     uid,
+				comm:    comm,
+				exe:     exe,
+				peerPid: peerPid,
+				peerUID: peerUID,
 			})
 		}
 	}
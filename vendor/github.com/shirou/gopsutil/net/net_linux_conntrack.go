@@ -0,0 +1,455 @@
+// +build linux
+
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/shirou/gopsutil/internal/common"
+)
+
+const (
+	netlinkNetfilter = 12 // NETLINK_NETFILTER
+
+	nfnlSubsysCtnetlink = 1 // NFNL_SUBSYS_CTNETLINK
+	ipctnlMsgCtGet      = 1 // IPCTNL_MSG_CT_GET
+	nfnlHdrLen          = 4 // struct nfgenmsg
+
+	ctaTupleOrig    = 1
+	ctaTupleReply   = 2
+	ctaStatus       = 3
+	ctaProtoinfo    = 4
+	ctaTimeout      = 7
+	ctaMark         = 8
+	ctaCountersOrig = 9
+	ctaCountersRepl = 10
+	ctaZone         = 18
+
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	ctaIPV4Src = 1
+	ctaIPV4Dst = 2
+	ctaIPV6Src = 3
+	ctaIPV6Dst = 4
+
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	ctaProtoinfoTCP      = 1
+	ctaProtoinfoTCPState = 1
+
+	ctaCountersPackets = 1
+	ctaCountersBytes   = 2
+
+	ipsNatMask = 0x30 // IPS_SRC_NAT | IPS_DST_NAT
+)
+
+// tcpConntrackStates maps the raw CTA_PROTOINFO_TCP_STATE value, i.e. the
+// kernel's enum tcp_conntrack, to its state name. Most names match those in
+// TCPStatuses; NONE and FIN_WAIT have no counterpart there.
+// This is a distinct sequence from sock_diag's idiag_state (tcpStatesByNumber):
+// only SYN_SENT and SYN_RECV line up, at idiag_state-1.
+var tcpConntrackStates = map[uint8]string{
+	0: "NONE",
+	1: "SYN_SENT",
+	2: "SYN_RECV",
+	3: "ESTABLISHED",
+	4: "FIN_WAIT",
+	5: "CLOSE_WAIT",
+	6: "LAST_ACK",
+	7: "TIME_WAIT",
+	8: "CLOSE",
+	9: "LISTEN",
+}
+
+// ConntrackFilter narrows the flows returned by NetConntrackEntries. A
+// zero value matches everything. Within one filter, Protocol and Zone must
+// both match; given several filters, a flow is kept if it matches any one.
+type ConntrackFilter struct {
+	// Protocol restricts the dump to a single L4 protocol, e.g. "tcp",
+	// "udp". Empty matches any protocol.
+	Protocol string
+	// Zone restricts the dump to a single conntrack zone. Zero means
+	// "don't filter by zone".
+	Zone uint16
+}
+
+// ConntrackTuple is one direction (original or reply) of a conntrack
+// flow's 5-tuple.
+type ConntrackTuple struct {
+	Src     string `json:"src"`
+	Dst     string `json:"dst"`
+	SrcPort uint16 `json:"srcPort"`
+	DstPort uint16 `json:"dstPort"`
+}
+
+// ConntrackCounters is the packet/byte counter pair conntrack keeps per
+// direction.
+type ConntrackCounters struct {
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// ConntrackFlow is a single entry of the kernel conntrack flow table.
+type ConntrackFlow struct {
+	Protocol string         `json:"protocol"`
+	Original ConntrackTuple `json:"original"`
+	Reply    ConntrackTuple `json:"reply"`
+	// TCPState is the conntrack TCP state name (see tcpConntrackStates),
+	// e.g. "ESTABLISHED", for TCP flows, and empty otherwise.
+	TCPState         string            `json:"tcpState"`
+	OriginalCounters ConntrackCounters `json:"originalCounters"`
+	ReplyCounters    ConntrackCounters `json:"replyCounters"`
+	TTL              uint32            `json:"ttl"`
+	Mark             uint32            `json:"mark"`
+	Zone             uint16            `json:"zone"`
+	// IsNAT reports whether the kernel has SNAT/DNAT applied to this
+	// flow, i.e. original and reply tuples were rewritten.
+	IsNAT bool `json:"isNat"`
+}
+
+// ConntrackPerCPUStat is one CPU's counters from /proc/net/stat/nf_conntrack.
+type ConntrackPerCPUStat struct {
+	CPU           int32 `json:"cpu"`
+	Found         int64 `json:"found"`
+	Invalid       int64 `json:"invalid"`
+	Ignore        int64 `json:"ignore"`
+	Insert        int64 `json:"insert"`
+	InsertFailed  int64 `json:"insertFailed"`
+	Drop          int64 `json:"drop"`
+	EarlyDrop     int64 `json:"earlyDrop"`
+	Error         int64 `json:"error"`
+	SearchRestart int64 `json:"searchRestart"`
+}
+
+// NetConntrackEntries enumerates the kernel's conntrack flow table. It
+// prefers netlink NFNL_SUBSYS_CTNETLINK (IPCTNL_MSG_CT_GET dump) and falls
+// back to parsing /proc/net/nf_conntrack if netlink is unavailable, e.g.
+// because nf_conntrack_netlink isn't loaded.
+func NetConntrackEntries(filters ...ConntrackFilter) ([]ConntrackFlow, error) {
+	flows, err := conntrackDumpNetlink()
+	if err != nil {
+		flows, err = parseConntrackProcFile(common.HostProc("net/nf_conntrack"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return applyConntrackFilters(flows, filters), nil
+}
+
+func applyConntrackFilters(flows []ConntrackFlow, filters []ConntrackFilter) []ConntrackFlow {
+	if len(filters) == 0 {
+		return flows
+	}
+	var ret []ConntrackFlow
+	for _, f := range flows {
+		for _, filt := range filters {
+			if filt.Protocol != "" && filt.Protocol != f.Protocol {
+				continue
+			}
+			if filt.Zone != 0 && filt.Zone != f.Zone {
+				continue
+			}
+			ret = append(ret, f)
+			break
+		}
+	}
+	return ret
+}
+
+// conntrackDumpNetlink issues an IPCTNL_MSG_CT_GET dump over
+// NETLINK_NETFILTER and decodes the nested CTA_* attributes of each
+// returned flow.
+func conntrackDumpNetlink() ([]ConntrackFlow, error) {
+	fd, err := openNetlinkSocket(netlinkNetfilter)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	// struct nfgenmsg { u8 nfgen_family; u8 version; u16 res_id; }
+	payload := []byte{syscall.AF_UNSPEC, 0 /* NFNETLINK_V0 */, 0, 0}
+	msgType := uint16(nfnlSubsysCtnetlink)<<8 | uint16(ipctnlMsgCtGet)
+	if err := sendNlmsgDump(fd, msgType, payload); err != nil {
+		return nil, err
+	}
+
+	var flows []ConntrackFlow
+	err = recvNlmsgDump(fd, func(data []byte) error {
+		if len(data) < nfnlHdrLen {
+			return nil
+		}
+		flow, err := parseConntrackNlMsg(data[nfnlHdrLen:])
+		if err != nil {
+			return nil // skip malformed records, keep draining the dump
+		}
+		flows = append(flows, flow)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
+func parseConntrackNlMsg(attrs []byte) (ConntrackFlow, error) {
+	var flow ConntrackFlow
+
+	walkNlAttrs(attrs, func(attrType uint16, value []byte) {
+		switch attrType &^ 0x8000 { // mask off NLA_F_NESTED
+		case ctaTupleOrig:
+			flow.Original, flow.Protocol = parseConntrackTuple(value)
+		case ctaTupleReply:
+			flow.Reply, _ = parseConntrackTuple(value)
+		case ctaProtoinfo:
+			flow.TCPState = parseConntrackTCPState(value)
+		case ctaCountersOrig:
+			flow.OriginalCounters = parseConntrackCounters(value)
+		case ctaCountersRepl:
+			flow.ReplyCounters = parseConntrackCounters(value)
+		case ctaTimeout:
+			if len(value) >= 4 {
+				flow.TTL = binary.BigEndian.Uint32(value)
+			}
+		case ctaMark:
+			if len(value) >= 4 {
+				flow.Mark = binary.BigEndian.Uint32(value)
+			}
+		case ctaZone:
+			if len(value) >= 2 {
+				flow.Zone = binary.BigEndian.Uint16(value)
+			}
+		case ctaStatus:
+			if len(value) >= 4 {
+				flow.IsNAT = binary.BigEndian.Uint32(value)&ipsNatMask != 0
+			}
+		}
+	})
+
+	return flow, nil
+}
+
+func parseConntrackTuple(attrs []byte) (tuple ConntrackTuple, protocol string) {
+	walkNlAttrs(attrs, func(attrType uint16, value []byte) {
+		switch attrType &^ 0x8000 {
+		case ctaTupleIP:
+			walkNlAttrs(value, func(ipAttrType uint16, ipValue []byte) {
+				switch ipAttrType &^ 0x8000 {
+				case ctaIPV4Src:
+					tuple.Src = net.IP(ipValue).String()
+				case ctaIPV4Dst:
+					tuple.Dst = net.IP(ipValue).String()
+				case ctaIPV6Src:
+					tuple.Src = net.IP(ipValue).String()
+				case ctaIPV6Dst:
+					tuple.Dst = net.IP(ipValue).String()
+				}
+			})
+		case ctaTupleProto:
+			walkNlAttrs(value, func(protoAttrType uint16, protoValue []byte) {
+				switch protoAttrType &^ 0x8000 {
+				case ctaProtoNum:
+					if len(protoValue) >= 1 {
+						protocol = protocolName(protoValue[0])
+					}
+				case ctaProtoSrcPort:
+					if len(protoValue) >= 2 {
+						tuple.SrcPort = binary.BigEndian.Uint16(protoValue)
+					}
+				case ctaProtoDstPort:
+					if len(protoValue) >= 2 {
+						tuple.DstPort = binary.BigEndian.Uint16(protoValue)
+					}
+				}
+			})
+		}
+	})
+	return tuple, protocol
+}
+
+func parseConntrackTCPState(attrs []byte) string {
+	var state string
+	walkNlAttrs(attrs, func(attrType uint16, value []byte) {
+		if attrType&^0x8000 != ctaProtoinfoTCP {
+			return
+		}
+		walkNlAttrs(value, func(tcpAttrType uint16, tcpValue []byte) {
+			if tcpAttrType&^0x8000 == ctaProtoinfoTCPState && len(tcpValue) >= 1 {
+				state = tcpConntrackStates[tcpValue[0]]
+			}
+		})
+	})
+	return state
+}
+
+func parseConntrackCounters(attrs []byte) ConntrackCounters {
+	var c ConntrackCounters
+	walkNlAttrs(attrs, func(attrType uint16, value []byte) {
+		switch attrType &^ 0x8000 {
+		case ctaCountersPackets:
+			if len(value) >= 8 {
+				c.Packets = binary.BigEndian.Uint64(value)
+			}
+		case ctaCountersBytes:
+			if len(value) >= 8 {
+				c.Bytes = binary.BigEndian.Uint64(value)
+			}
+		}
+	})
+	return c
+}
+
+func protocolName(num byte) string {
+	switch num {
+	case syscall.IPPROTO_TCP:
+		return "tcp"
+	case syscall.IPPROTO_UDP:
+		return "udp"
+	case syscall.IPPROTO_ICMP:
+		return "icmp"
+	case syscall.IPPROTO_ICMPV6:
+		return "icmpv6"
+	default:
+		return fmt.Sprintf("proto-%d", num)
+	}
+}
+
+// walkNlAttrs iterates a (possibly nested) rtattr list as used by
+// ctnetlink, invoking fn with the value of each top-level attribute. The
+// attribute header (len, type) is always host/little-endian; it is the
+// attribute *values* that ctnetlink encodes big-endian, unlike sock_diag.
+func walkNlAttrs(attrs []byte, fn func(attrType uint16, value []byte)) {
+	for len(attrs) >= 4 {
+		attrLen := int(binary.LittleEndian.Uint16(attrs[0:2]))
+		attrType := binary.LittleEndian.Uint16(attrs[2:4])
+		if attrLen < 4 || attrLen > len(attrs) {
+			return
+		}
+		fn(attrType, attrs[4:attrLen])
+		advance := (attrLen + 3) &^ 3
+		if advance == 0 || advance > len(attrs) {
+			return
+		}
+		attrs = attrs[advance:]
+	}
+}
+
+// NetConntrackStatsPerCPU parses /proc/net/stat/nf_conntrack for the
+// per-CPU found/invalid/ignore/insert/insert_failed/drop/early_drop/
+// error/search_restart counters.
+func NetConntrackStatsPerCPU() ([]ConntrackPerCPUStat, error) {
+	filename := common.HostProc("net/stat/nf_conntrack")
+	lines, err := common.ReadLines(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf(filename + " is not formatted correctly")
+	}
+
+	var stats []ConntrackPerCPUStat
+	for cpu, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 17 {
+			continue
+		}
+		values := make([]int64, len(fields))
+		for i, f := range fields {
+			v, err := strconv.ParseInt(f, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		stats = append(stats, ConntrackPerCPUStat{
+			CPU:           int32(cpu),
+			Found:         values[2],
+			Invalid:       values[4],
+			Ignore:        values[5],
+			Insert:        values[8],
+			InsertFailed:  values[9],
+			Drop:          values[10],
+			EarlyDrop:     values[11],
+			Error:         values[12],
+			SearchRestart: values[16],
+		})
+	}
+	return stats, nil
+}
+
+// parseConntrackProcFile parses the legacy /proc/net/nf_conntrack text
+// format, used as a fallback when ctnetlink dumps are unavailable. Each
+// line looks like:
+//   tcp 6 431999 ESTABLISHED src=10.0.0.1 dst=10.0.0.2 sport=1234 dport=80
+//   src=10.0.0.2 dst=10.0.0.1 sport=80 dport=1234 [ASSURED] mark=0 zone=0 use=2
+func parseConntrackProcFile(filename string) ([]ConntrackFlow, error) {
+	lines, err := common.ReadLines(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var flows []ConntrackFlow
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		flow := ConntrackFlow{Protocol: fields[0]}
+
+		seenReply := false
+		for _, kv := range fields[3:] {
+			switch {
+			case kv == "[ASSURED]":
+				continue
+			case strings.HasPrefix(kv, "src="):
+				if !seenReply {
+					flow.Original.Src = kv[4:]
+				} else {
+					flow.Reply.Src = kv[4:]
+				}
+			case strings.HasPrefix(kv, "dst="):
+				if !seenReply {
+					flow.Original.Dst = kv[4:]
+				} else {
+					flow.Reply.Dst = kv[4:]
+				}
+			case strings.HasPrefix(kv, "sport="):
+				port, _ := strconv.ParseUint(kv[6:], 10, 16)
+				if !seenReply {
+					flow.Original.SrcPort = uint16(port)
+				} else {
+					flow.Reply.SrcPort = uint16(port)
+				}
+			case strings.HasPrefix(kv, "dport="):
+				port, _ := strconv.ParseUint(kv[6:], 10, 16)
+				if !seenReply {
+					flow.Original.DstPort = uint16(port)
+					seenReply = true
+				} else {
+					flow.Reply.DstPort = uint16(port)
+				}
+			case strings.HasPrefix(kv, "mark="):
+				mark, _ := strconv.ParseUint(kv[5:], 10, 32)
+				flow.Mark = uint32(mark)
+			case strings.HasPrefix(kv, "zone="):
+				zone, _ := strconv.ParseUint(kv[5:], 10, 16)
+				flow.Zone = uint16(zone)
+			case flow.Protocol == "tcp" && kv == fields[3]:
+				flow.TCPState = kv
+			}
+		}
+		if flow.Original.Src != flow.Reply.Dst || flow.Original.Dst != flow.Reply.Src {
+			flow.IsNAT = true
+		}
+
+		flows = append(flows, flow)
+	}
+	return flows, nil
+}
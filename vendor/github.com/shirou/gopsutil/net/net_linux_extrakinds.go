@@ -0,0 +1,281 @@
+// +build linux
+
+package net
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/shirou/gopsutil/internal/common"
+)
+
+// IncludeExtendedKindsInAll gates whether NetConnections("all") /
+// NetConnectionsPid("all", ...) also walk the SCTP, raw and packet-socket
+// kinds added alongside kindSCTP/kindRAW4/kindRAW6/kindPacket. It defaults
+// to false so existing callers of kind "all" keep seeing the same
+// TCP/UDP/UNIX result set they always have; callers that want the wider
+// sweep must opt in explicitly.
+var IncludeExtendedKindsInAll = false
+
+// kindSCTP's family is nominal: /proc/net/sctp/assocs lists associations
+// of both address families in one combined table with no per-row family
+// tag, unlike tcp/tcp6 or udp/udp6 which each get their own file. Laddrs
+// and Raddrs carry the real, possibly-mixed-family addresses regardless.
+var kindSCTP = netConnectionKindType{
+	family:   syscall.AF_INET,
+	sockType: syscall.SOCK_STREAM,
+	filename: "sctp/assocs",
+}
+var kindRAW4 = netConnectionKindType{
+	family:   syscall.AF_INET,
+	sockType: syscall.SOCK_RAW,
+	filename: "raw",
+}
+var kindRAW6 = netConnectionKindType{
+	family:   syscall.AF_INET6,
+	sockType: syscall.SOCK_RAW,
+	filename: "raw6",
+}
+var kindPacket = netConnectionKindType{
+	family:   syscall.AF_PACKET,
+	filename: "packet",
+}
+
+// allKindsExtended is the "all" kind list used when
+// IncludeExtendedKindsInAll is set: the original TCP/UDP/UNIX kinds plus
+// SCTP, raw and packet sockets.
+var allKindsExtended = []netConnectionKindType{
+	kindTCP4, kindTCP6, kindUDP4, kindUDP6, kindUNIX,
+	kindSCTP, kindRAW4, kindRAW6, kindPacket,
+}
+
+func init() {
+	// sctp4/sctp6 both read /proc/net/sctp/assocs: the kernel doesn't
+	// split SCTP associations by family the way it does tcp/tcp6, so
+	// there's nothing more specific to point either alias at.
+	netConnectionKindMap["sctp"] = []netConnectionKindType{kindSCTP}
+	netConnectionKindMap["sctp4"] = []netConnectionKindType{kindSCTP}
+	netConnectionKindMap["sctp6"] = []netConnectionKindType{kindSCTP}
+	netConnectionKindMap["raw"] = []netConnectionKindType{kindRAW4}
+	netConnectionKindMap["raw6"] = []netConnectionKindType{kindRAW6}
+	netConnectionKindMap["packet"] = []netConnectionKindType{kindPacket}
+}
+
+// sctpStatuses maps the numeric ST column of /proc/net/sctp/assocs to the
+// enum sctp_state names from <net/sctp/constants.h>.
+var sctpStatuses = map[string]string{
+	"0": "CLOSED",
+	"1": "COOKIE_WAIT",
+	"2": "COOKIE_ECHOED",
+	"3": "ESTABLISHED",
+	"4": "SHUTDOWN_PENDING",
+	"5": "SHUTDOWN_SENT",
+	"6": "SHUTDOWN_RECEIVED",
+	"7": "SHUTDOWN_ACK_SENT",
+}
+
+// sctpTrailerCols is the number of fixed columns that follow the RADDRS
+// address list in /proc/net/sctp/assocs: HBINT INS OUTS MAXRT T1X T2X RTXC
+// wmema wmemq sndbuf rcvbuf.
+const sctpTrailerCols = 11
+
+// processSCTP parses /proc/net/sctp/assocs. Unlike TCP/UDP, each
+// association can be bound to more than one local and remote address, so
+// the fixed-width field parsing used by processInet doesn't apply: the
+// LADDRS and RADDRS columns are variable-length, separated by a literal
+// "<->" token. Columns up to LADDRS are fixed-width: ASSOC SOCK STY SST ST
+// HBKT ASSOC-ID TX_QUEUE RX_QUEUE UID INODE LPORT RPORT.
+func processSCTP(file string, kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32, owners procOwnerCache) ([]connTmp, error) {
+	if !common.PathExists(file) {
+		// SCTP module not loaded.
+		return []connTmp{}, nil
+	}
+	lines, err := common.ReadLines(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 1 {
+		return []connTmp{}, nil
+	}
+
+	var ret []connTmp
+	for _, line := range lines[1:] {
+		tokens := strings.Fields(line)
+		if len(tokens) < 13+sctpTrailerCols {
+			continue
+		}
+
+		arrow := -1
+		for i, tok := range tokens {
+			if tok == "<->" {
+				arrow = i
+				break
+			}
+		}
+		if arrow < 0 || arrow < 14 {
+			continue
+		}
+
+		laddrTokens := tokens[13:arrow]
+		raddrEnd := len(tokens) - sctpTrailerCols
+		if raddrEnd <= arrow+1 {
+			continue
+		}
+		raddrTokens := tokens[arrow+1 : raddrEnd]
+
+		laddrs := decodeSCTPAddrs(laddrTokens, kind.family, tokens[11])
+		raddrs := decodeSCTPAddrs(raddrTokens, kind.family, tokens[12])
+		if len(laddrs) == 0 || len(raddrs) == 0 {
+			continue
+		}
+
+		status := sctpStatuses[tokens[4]]
+		if status == "" {
+			status = "UNKNOWN"
+		}
+
+		uid := int32(-1)
+		if v, err := strconv.ParseInt(tokens[9], 10, 32); err == nil {
+			uid = int32(v)
+		}
+
+		inode := tokens[10]
+		pid := int32(0)
+		fd := uint32(0)
+		if i, exists := inodes[inode]; exists {
+			pid = i[0].pid
+			fd = i[0].fd
+		}
+		if filterPid > 0 && filterPid != pid {
+			continue
+		}
+
+		_, comm, exe := owners.get(common.HostProc(), pid)
+
+		ret = append(ret, connTmp{
+			fd:       fd,
+			family:   kind.family,
+			sockType: kind.sockType,
+			laddr:    laddrs[0],
+			raddr:    raddrs[0],
+			laddrs:   laddrs,
+			raddrs:   raddrs,
+			status:   status,
+			pid:      pid,
+			uid:      uid,
+			comm:     comm,
+			exe:      exe,
+		})
+	}
+
+	return ret, nil
+}
+
+// decodeSCTPAddrs turns the bare IP strings of an SCTP LADDRS/RADDRS list
+// into Addrs, all sharing the association's single LPORT/RPORT.
+func decodeSCTPAddrs(ipTokens []string, family uint32, portStr string) []Addr {
+	port, err := strconv.ParseUint(portStr, 10, 32)
+	if err != nil {
+		return nil
+	}
+	addrs := make([]Addr, 0, len(ipTokens))
+	for _, ip := range ipTokens {
+		ip = strings.TrimPrefix(ip, "*")
+		if ip == "" {
+			continue
+		}
+		addrs = append(addrs, Addr{IP: ip, Port: uint32(port)})
+	}
+	return addrs
+}
+
+// ethProtoNames maps the handful of ETH_P_* values most commonly bound by
+// AF_PACKET sockets to their familiar names, e.g. from <linux/if_ether.h>.
+var ethProtoNames = map[uint32]string{
+	0x0003: "ETH_P_ALL",
+	0x0800: "ETH_P_IP",
+	0x0806: "ETH_P_ARP",
+	0x8035: "ETH_P_RARP",
+	0x8100: "ETH_P_8021Q",
+	0x86DD: "ETH_P_IPV6",
+}
+
+// processPacket parses /proc/net/packet, the AF_PACKET socket table. These
+// sockets aren't peered with another address the way TCP/UDP/UNIX are, so
+// Raddr is left empty; Status instead carries the bound protocol's
+// ETH_P_* name (or "ETH_P_0x<hex>" if unrecognized) and Laddr.IP the bound
+// interface name.
+func processPacket(file string, kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32, owners procOwnerCache) ([]connTmp, error) {
+	lines, err := common.ReadLines(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) < 1 {
+		return []connTmp{}, nil
+	}
+
+	var ret []connTmp
+	for _, line := range lines[1:] {
+		tokens := strings.Fields(line)
+		if len(tokens) < 9 {
+			continue
+		}
+		// sk RefCnt Type Proto Iface R Rmem User Inode
+		sockType, err := strconv.ParseUint(tokens[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		proto, err := strconv.ParseUint(tokens[3], 16, 32)
+		if err != nil {
+			continue
+		}
+		ifindex, err := strconv.Atoi(tokens[4])
+		if err != nil {
+			continue
+		}
+		userUID, err := strconv.ParseInt(tokens[7], 10, 32)
+		if err != nil {
+			userUID = -1
+		}
+		inode := tokens[8]
+
+		ifname := fmt.Sprintf("if%d", ifindex)
+		if iface, err := net.InterfaceByIndex(ifindex); err == nil {
+			ifname = iface.Name
+		}
+
+		protoName, ok := ethProtoNames[uint32(proto)]
+		if !ok {
+			protoName = fmt.Sprintf("ETH_P_0x%04X", proto)
+		}
+
+		pid := int32(0)
+		fd := uint32(0)
+		if i, exists := inodes[inode]; exists {
+			pid = i[0].pid
+			fd = i[0].fd
+		}
+		if filterPid > 0 && filterPid != pid {
+			continue
+		}
+
+		_, comm, exe := owners.get(common.HostProc(), pid)
+
+		ret = append(ret, connTmp{
+			fd:       fd,
+			family:   kind.family,
+			sockType: uint32(sockType),
+			laddr:    Addr{IP: ifname, Port: uint32(proto)},
+			status:   protoName,
+			pid:      pid,
+			uid:      int32(userUID),
+			comm:     comm,
+			exe:      exe,
+		})
+	}
+
+	return ret, nil
+}
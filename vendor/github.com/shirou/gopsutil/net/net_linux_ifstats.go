@@ -0,0 +1,293 @@
+// +build linux
+
+package net
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/shirou/gopsutil/internal/common"
+)
+
+const (
+	siocEthtool = 0x8946 // SIOCETHTOOL
+
+	ethtoolCmdGDrvinfo = 0x00000003
+	ethtoolCmdGStrings = 0x0000001b
+	ethtoolCmdGStats   = 0x0000001d
+
+	ethSSStats    = 1
+	ethGStringLen = 32
+)
+
+// NetQueueStat is one rx-N/tx-N queue's sysfs counters, as found under
+// /sys/class/net/<ifname>/queues/.
+type NetQueueStat struct {
+	Name  string           `json:"name"` // e.g. "rx-0", "tx-0"
+	Stats map[string]int64 `json:"stats"`
+}
+
+// NetInterfaceStat is link, queue and driver level detail for a single
+// network interface, complementing the byte/packet counters already
+// returned by NetIOCounters.
+type NetInterfaceStat struct {
+	Name string `json:"name"`
+	// OperState is /sys/class/net/<ifname>/operstate, e.g. "up", "down",
+	// "unknown".
+	OperState string `json:"operState"`
+	Carrier   bool   `json:"carrier"`
+	// Speed is the negotiated link speed in Mb/s, or -1 if it cannot be
+	// determined (link down, driver doesn't report it).
+	Speed int64 `json:"speed"`
+	// Duplex is "full", "half" or "unknown".
+	Duplex string `json:"duplex"`
+	MTU    int    `json:"mtu"`
+
+	Queues []NetQueueStat `json:"queues"`
+
+	// DriverStats holds the NIC/driver specific counters normally read
+	// with `ethtool -S`, e.g. rx_dropped_nomem, rx_length_errors,
+	// tx_heartbeat_errors. Empty if the driver exposes none.
+	DriverStats map[string]uint64 `json:"driverStats"`
+}
+
+// NetInterfaceStats returns link, per-queue and driver level statistics
+// for every network interface, pulling driver counters via ethtool.
+func NetInterfaceStats() ([]NetInterfaceStat, error) {
+	ifaces, err := ioutil.ReadDir(common.HostSys("class/net"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]NetInterfaceStat, 0, len(ifaces))
+	for _, iface := range ifaces {
+		name := iface.Name()
+		stat := NetInterfaceStat{Name: name}
+
+		stat.OperState = strings.TrimSpace(readSysClassNetFile(name, "operstate"))
+		stat.Carrier = readSysClassNetInt(name, "carrier") == 1
+		stat.Speed = readSysClassNetSpeed(name)
+		stat.Duplex = strings.TrimSpace(readSysClassNetFile(name, "duplex"))
+		if stat.Duplex == "" {
+			stat.Duplex = "unknown"
+		}
+		if mtu := readSysClassNetInt(name, "mtu"); mtu > 0 {
+			stat.MTU = int(mtu)
+		}
+
+		stat.Queues = readQueueStats(name)
+
+		driverStats, err := ethtoolStats(name)
+		if err == nil {
+			stat.DriverStats = driverStats
+		}
+
+		ret = append(ret, stat)
+	}
+
+	return ret, nil
+}
+
+func readSysClassNetFile(ifname, file string) string {
+	b, err := ioutil.ReadFile(common.HostSys(filepath.Join("class/net", ifname, file)))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// readSysClassNetSpeed reads the "speed" sysfs file, which returns -1 (or
+// EINVAL) when the link is down; gopsutil reports that as -1 too rather
+// than guessing.
+func readSysClassNetSpeed(ifname string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(readSysClassNetFile(ifname, "speed")), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+func readSysClassNetInt(ifname, file string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(readSysClassNetFile(ifname, file)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// readQueueStats walks /sys/class/net/<ifname>/queues, collecting every
+// numeric counter file under each rx-N/tx-N directory (rps_flow_cnt,
+// tx_timeout and friends; non-numeric files like rps_cpus bitmaps are
+// skipped).
+func readQueueStats(ifname string) []NetQueueStat {
+	queueDir := common.HostSys(filepath.Join("class/net", ifname, "queues"))
+	entries, err := ioutil.ReadDir(queueDir)
+	if err != nil {
+		return nil
+	}
+
+	var ret []NetQueueStat
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(queueDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		stats := make(map[string]int64)
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			raw, err := ioutil.ReadFile(filepath.Join(queueDir, entry.Name(), f.Name()))
+			if err != nil {
+				continue
+			}
+			v, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+			if err != nil {
+				continue
+			}
+			stats[f.Name()] = v
+		}
+		if len(stats) > 0 {
+			ret = append(ret, NetQueueStat{Name: entry.Name(), Stats: stats})
+		}
+	}
+	return ret
+}
+
+// ethtoolStats fetches driver-level statistics the way `ethtool -S` does:
+// ETHTOOL_GDRVINFO for the stat count, ETHTOOL_GSTRINGS for their names,
+// then ETHTOOL_GSTATS for the values. It uses the legacy SIOCETHTOOL
+// ioctl; newer kernels also expose this via the ethtool netlink family
+// (ETHTOOL_MSG_STATS_GET), but the ioctl works unconditionally and is
+// what gopsutil uses here.
+func ethtoolStats(ifname string) (map[string]uint64, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	nStats, err := ethtoolNStats(fd, ifname)
+	if err != nil {
+		return nil, err
+	}
+	if nStats == 0 {
+		return nil, nil
+	}
+
+	names, err := ethtoolGStrings(fd, ifname, nStats)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := ethtoolGStats(fd, ifname, nStats)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]uint64, nStats)
+	for i := 0; i < nStats && i < len(names) && i < len(values); i++ {
+		if names[i] == "" {
+			continue
+		}
+		stats[names[i]] = values[i]
+	}
+	return stats, nil
+}
+
+// ethtoolIoctl issues a SIOCETHTOOL ioctl with data as the ethtool command
+// struct, which must start with a uint32 "cmd" field as the kernel ABI
+// requires.
+func ethtoolIoctl(fd int, ifname string, data []byte) error {
+	var ifreq [40]byte
+	copy(ifreq[:syscall.IFNAMSIZ], ifname)
+	*(*uintptr)(unsafe.Pointer(&ifreq[16])) = uintptr(unsafe.Pointer(&data[0]))
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(siocEthtool), uintptr(unsafe.Pointer(&ifreq[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func ethtoolNStats(fd int, ifname string) (int, error) {
+	// struct ethtool_drvinfo { u32 cmd; char driver[32]; char version[32];
+	// char fw_version[32]; char bus_info[32]; char erom_version[32];
+	// char reserved2[12]; u32 n_priv_flags; u32 n_stats; u32 testinfo_len;
+	// u32 eedump_len; u32 regdump_len; }
+	buf := make([]byte, 4+32+32+32+32+32+12+4+4+4+4+4)
+	putUint32(buf, 0, ethtoolCmdGDrvinfo)
+	if err := ethtoolIoctl(fd, ifname, buf); err != nil {
+		return 0, err
+	}
+	nStatsOffset := 4 + 32 + 32 + 32 + 32 + 32 + 12 + 4
+	return int(getUint32(buf, nStatsOffset)), nil
+}
+
+// ethtoolGStrings fetches the ETH_SS_STATS string table, returning each
+// stat's name in order.
+func ethtoolGStrings(fd int, ifname string, n int) ([]string, error) {
+	// struct ethtool_gstrings { u32 cmd; u32 string_set; u32 len; u8 data[]; }
+	buf := make([]byte, 12+n*ethGStringLen)
+	putUint32(buf, 0, ethtoolCmdGStrings)
+	putUint32(buf, 4, ethSSStats)
+	putUint32(buf, 8, uint32(n))
+	if err := ethtoolIoctl(fd, ifname, buf); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, n)
+	for i := 0; i < n; i++ {
+		start := 12 + i*ethGStringLen
+		raw := buf[start : start+ethGStringLen]
+		if nul := strings.IndexByte(string(raw), 0); nul >= 0 {
+			raw = raw[:nul]
+		}
+		names[i] = string(raw)
+	}
+	return names, nil
+}
+
+// ethtoolGStats fetches the ETHTOOL_GSTATS counter values, in the same
+// order as ethtoolGStrings.
+func ethtoolGStats(fd int, ifname string, n int) ([]uint64, error) {
+	// struct ethtool_stats { u32 cmd; u32 n_stats; u64 data[]; }
+	buf := make([]byte, 8+n*8)
+	putUint32(buf, 0, ethtoolCmdGStats)
+	putUint32(buf, 4, uint32(n))
+	if err := ethtoolIoctl(fd, ifname, buf); err != nil {
+		return nil, err
+	}
+
+	values := make([]uint64, n)
+	for i := 0; i < n; i++ {
+		values[i] = getUint64(buf, 8+i*8)
+	}
+	return values, nil
+}
+
+func putUint32(buf []byte, offset int, v uint32) {
+	buf[offset] = byte(v)
+	buf[offset+1] = byte(v >> 8)
+	buf[offset+2] = byte(v >> 16)
+	buf[offset+3] = byte(v >> 24)
+}
+
+func getUint32(buf []byte, offset int) uint32 {
+	return uint32(buf[offset]) | uint32(buf[offset+1])<<8 | uint32(buf[offset+2])<<16 | uint32(buf[offset+3])<<24
+}
+
+func getUint64(buf []byte, offset int) uint64 {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v |= uint64(buf[offset+i]) << (8 * uint(i))
+	}
+	return v
+}
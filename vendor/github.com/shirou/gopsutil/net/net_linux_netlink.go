@@ -0,0 +1,601 @@
+// +build linux
+
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/shirou/gopsutil/internal/common"
+)
+
+// Backend selects which data source NetConnections/NetConnectionsPid use to
+// enumerate sockets.
+type Backend int
+
+const (
+	// BackendProcfs parses /proc/net/{tcp,tcp6,udp,udp6,unix}, as gopsutil
+	// has always done.
+	BackendProcfs Backend = iota
+	// BackendNetlink uses the sock_diag(7) netlink subsystem
+	// (NETLINK_SOCK_DIAG) to fetch the whole connection table in one
+	// syscall round-trip instead of parsing /proc/net line by line.
+	BackendNetlink
+)
+
+// netBackendEnvVar is read by DefaultBackend, so callers that pass
+// DefaultBackend() to NetConnectionsWithBackend let operators pick a
+// backend at run time, e.g. GOPSUTIL_NET_BACKEND=netlink. NetConnections
+// and NetConnectionsPid do not read it.
+const netBackendEnvVar = "GOPSUTIL_NET_BACKEND"
+
+const (
+	netlinkSockDiag = 4 // NETLINK_SOCK_DIAG; not exposed by the stdlib syscall package
+
+	sockDiagByFamily = 20 // SOCK_DIAG_BY_FAMILY
+
+	nlmFRequest = 0x1
+	nlmFDump    = 0x100 | 0x200 // NLM_F_ROOT | NLM_F_MATCH
+	nlmsgDone   = 0x3
+	nlmsgError  = 0x2
+	nlmsgHdrLen = 16
+
+	sizeofInetDiagReqV2 = 56
+	sizeofInetDiagMsg   = 72
+
+	unixDiagName = 0 // UNIX_DIAG_NAME
+	unixDiagPeer = 2 // UNIX_DIAG_PEER
+
+	udiagShowName = 1 << 0
+	udiagShowPeer = 1 << 2
+)
+
+// inetDiagReqV2 mirrors struct inet_diag_req_v2 from
+// include/uapi/linux/inet_diag.h.
+type inetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       inetDiagSockID
+}
+
+// inetDiagSockID mirrors struct inet_diag_sockid.
+type inetDiagSockID struct {
+	SPort  [2]byte
+	DPort  [2]byte
+	Src    [16]byte
+	Dst    [16]byte
+	If     uint32
+	Cookie [2]uint32
+}
+
+// inetDiagMsg mirrors struct inet_diag_msg, the payload of every
+// sock_diag response for TCP/UDP sockets.
+type inetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      inetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// unixDiagReq mirrors struct unix_diag_req.
+type unixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie0  uint32
+	Cookie1  uint32
+}
+
+// unixDiagMsg mirrors struct unix_diag_msg, the payload of every sock_diag
+// response for AF_UNIX sockets.
+type unixDiagMsg struct {
+	Family   uint8
+	SockType uint8
+	State    uint8
+	Pad      uint8
+	Inode    uint32
+	Cookie0  uint32
+	Cookie1  uint32
+}
+
+// tcpStatesByNumber maps the numeric idiag_state reported by sock_diag to
+// the textual names already used in TCPStatuses.
+var tcpStatesByNumber = map[uint8]string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+}
+
+// allTCPStates is the idiag_states bitmask matching every state in
+// tcpStatesByNumber, i.e. "give me everything".
+var allTCPStates = func() uint32 {
+	var mask uint32
+	for state := range tcpStatesByNumber {
+		mask |= 1 << state
+	}
+	return mask
+}()
+
+// NetConnectionsWithBackend behaves like NetConnectionsPid but lets the
+// caller pick the backend explicitly. It transparently falls back to the
+// procfs backend if the kernel does not support sock_diag.
+func NetConnectionsWithBackend(kind string, pid int32, backend Backend) ([]NetConnectionStat, error) {
+	if backend == BackendProcfs {
+		return NetConnectionsPid(kind, pid)
+	}
+
+	ret, err := netConnectionsNetlink(kind, pid)
+	if err == nil {
+		return ret, nil
+	}
+	if !isUnsupportedSockDiag(err) {
+		return nil, err
+	}
+	return NetConnectionsPid(kind, pid)
+}
+
+// DefaultBackend resolves the GOPSUTIL_NET_BACKEND environment variable to
+// a Backend, defaulting to BackendProcfs so existing callers see no change
+// in behavior unless they opt in, e.g.:
+//
+//	net.NetConnectionsWithBackend("tcp", 0, net.DefaultBackend())
+func DefaultBackend() Backend {
+	if os.Getenv(netBackendEnvVar) == "netlink" {
+		return BackendNetlink
+	}
+	return BackendProcfs
+}
+
+// isUnsupportedSockDiag reports whether err indicates the running kernel
+// lacks NETLINK_SOCK_DIAG support (ENOENT/EPROTONOSUPPORT on bind).
+func isUnsupportedSockDiag(err error) bool {
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+	return errno == syscall.ENOENT || errno == syscall.EPROTONOSUPPORT
+}
+
+func netConnectionsNetlink(kind string, filterPid int32) ([]NetConnectionStat, error) {
+	tmap, ok := netConnectionKindMap[kind]
+	if kind == "all" && IncludeExtendedKindsInAll {
+		tmap = allKindsExtended
+		ok = true
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid kind, %s", kind)
+	}
+	for _, t := range tmap {
+		if t.family == syscall.AF_PACKET || t.sockType == syscall.SOCK_RAW || t.filename == kindSCTP.filename {
+			// Only TCP, UDP and UNIX sockets are dumped via sock_diag;
+			// the SCTP, raw and packet kinds are read from procfs.
+			return NetConnectionsPid(kind, filterPid)
+		}
+	}
+
+	root := common.HostProc()
+	var inodes map[string][]inodeMap
+	var err error
+	if filterPid == 0 {
+		inodes, err = getProcInodesAll(root)
+	} else {
+		inodes, err = getProcInodes(root, filterPid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dupCheckMap := make(map[string]bool)
+	var ret []NetConnectionStat
+	owners := make(procOwnerCache)
+
+	for _, t := range tmap {
+		var conns []connTmp
+		var err error
+		switch t.family {
+		case syscall.AF_INET, syscall.AF_INET6:
+			conns, err = inetDiagDump(t, inodes, filterPid)
+		case syscall.AF_UNIX:
+			conns, err = unixDiagDump(t, inodes, filterPid)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range conns {
+			conn := NetConnectionStat{
+				Fd:        c.fd,
+				Family:    c.family,
+				Type:      c.sockType,
+				Laddr:     c.laddr,
+				Raddr:     c.raddr,
+				Status:    c.status,
+				Pid:       c.pid,
+				PeerInode: c.peerInode,
+				UID:       c.uid,
+			}
+			if c.pid == 0 {
+				conn.Pid = c.boundPid
+			}
+			uid, comm, exe := owners.get(root, conn.Pid)
+			conn.Comm, conn.Exe = comm, exe
+			if c.family == syscall.AF_UNIX {
+				conn.UID = uid
+				conn.PeerUID = -1
+				if peers, ok := inodes[fmt.Sprintf("%d", c.peerInode)]; ok && c.peerInode != 0 {
+					conn.PeerPid = peers[0].pid
+					conn.PeerUID, _, _ = owners.get(root, conn.PeerPid)
+				}
+			}
+			json := conn.String()
+			if !dupCheckMap[json] {
+				ret = append(ret, conn)
+				dupCheckMap[json] = true
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// openSockDiagSocket opens and binds a NETLINK_SOCK_DIAG socket.
+func openSockDiagSocket() (int, error) {
+	return openNetlinkSocket(netlinkSockDiag)
+}
+
+// openNetlinkSocket opens and binds a netlink socket of the given netlink
+// protocol family (e.g. NETLINK_SOCK_DIAG, NETLINK_NETFILTER).
+func openNetlinkSocket(proto int) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, proto)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// sendNlmsgDump wraps payload in a nlmsghdr requesting a dump of msgType.
+func sendNlmsgDump(fd int, msgType uint16, payload []byte) error {
+	hdr := make([]byte, nlmsgHdrLen)
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(nlmsgHdrLen+len(payload)))
+	binary.LittleEndian.PutUint16(hdr[4:6], msgType)
+	binary.LittleEndian.PutUint16(hdr[6:8], nlmFRequest|nlmFDump)
+	binary.LittleEndian.PutUint32(hdr[8:12], 1) // sequence number
+	binary.LittleEndian.PutUint32(hdr[12:16], 0)
+	return syscall.Sendto(fd, append(hdr, payload...), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// recvNlmsgDump reads NLMSG_DONE-terminated netlink responses off fd,
+// invoking handle with the payload of every non-control message.
+func recvNlmsgDump(fd int, handle func([]byte) error) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		data := buf[:n]
+		for len(data) >= nlmsgHdrLen {
+			msgLen := binary.LittleEndian.Uint32(data[0:4])
+			msgType := binary.LittleEndian.Uint16(data[4:6])
+			if msgLen < nlmsgHdrLen || int(msgLen) > len(data) {
+				return fmt.Errorf("malformed netlink message")
+			}
+			switch msgType {
+			case nlmsgDone:
+				return nil
+			case nlmsgError:
+				errno := int32(binary.LittleEndian.Uint32(data[nlmsgHdrLen : nlmsgHdrLen+4]))
+				if errno != 0 {
+					return syscall.Errno(-errno)
+				}
+			default:
+				if err := handle(data[nlmsgHdrLen:msgLen]); err != nil {
+					return err
+				}
+			}
+			// messages are aligned to 4 bytes
+			aligned := (int(msgLen) + 3) &^ 3
+			data = data[aligned:]
+		}
+	}
+}
+
+// inetDiagDump issues an INET_DIAG_REQ_V2 dump for the given kind
+// (TCP4/TCP6/UDP4/UDP6) and decodes the inet_diag_msg responses.
+func inetDiagDump(kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32) ([]connTmp, error) {
+	fd, err := openSockDiagSocket()
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	protocol := uint8(syscall.IPPROTO_TCP)
+	states := allTCPStates
+	if kind.sockType == syscall.SOCK_DGRAM {
+		protocol = syscall.IPPROTO_UDP
+		states = 0xffffffff // UDP has no state machine worth filtering on
+	}
+
+	req := inetDiagReqV2{
+		Family:   uint8(kind.family),
+		Protocol: protocol,
+		States:   states,
+	}
+	if err := sendNlmsgDump(fd, sockDiagByFamily, marshalInetDiagReqV2(&req)); err != nil {
+		return nil, err
+	}
+
+	var ret []connTmp
+	err = recvNlmsgDump(fd, func(data []byte) error {
+		msg, err := parseInetDiagMsg(data)
+		if err != nil {
+			// Skip truncated records rather than aborting the whole dump.
+			return nil
+		}
+		inode := fmt.Sprintf("%d", msg.Inode)
+		pid := int32(0)
+		fdNum := uint32(0)
+		if im, exists := inodes[inode]; exists {
+			pid = im[0].pid
+			fdNum = im[0].fd
+		}
+		if filterPid > 0 && filterPid != pid {
+			return nil
+		}
+
+		status := "NONE"
+		if kind.sockType == syscall.SOCK_STREAM {
+			status = tcpStatesByNumber[msg.State]
+		}
+
+		ret = append(ret, connTmp{
+			fd:       fdNum,
+			family:   kind.family,
+			sockType: kind.sockType,
+			laddr:    diagAddr(kind.family, msg.ID.Src, msg.ID.SPort),
+			raddr:    diagAddr(kind.family, msg.ID.Dst, msg.ID.DPort),
+			status:   status,
+			pid:      pid,
+			uid:      int32(msg.UID),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// unixDiagDump issues a UNIX_DIAG dump with UDIAG_SHOW_NAME and
+// UDIAG_SHOW_PEER set so the peer's inode can be surfaced.
+func unixDiagDump(kind netConnectionKindType, inodes map[string][]inodeMap, filterPid int32) ([]connTmp, error) {
+	fd, err := openSockDiagSocket()
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	req := unixDiagReq{
+		Family:  syscall.AF_UNIX,
+		States:  0xffffffff,
+		Show:    udiagShowName | udiagShowPeer,
+		Cookie0: 0xffffffff,
+		Cookie1: 0xffffffff,
+	}
+	if err := sendNlmsgDump(fd, sockDiagByFamily, marshalUnixDiagReq(&req)); err != nil {
+		return nil, err
+	}
+
+	var ret []connTmp
+	err = recvNlmsgDump(fd, func(data []byte) error {
+		msg, attrs, err := parseUnixDiagMsg(data)
+		if err != nil {
+			return nil
+		}
+		name, peerInode := parseUnixDiagAttrs(attrs)
+		inode := fmt.Sprintf("%d", msg.Inode)
+
+		pairs, exists := inodes[inode]
+		if !exists {
+			pairs = []inodeMap{{}}
+		}
+		for _, pair := range pairs {
+			if filterPid > 0 && filterPid != pair.pid {
+				continue
+			}
+			ret = append(ret, connTmp{
+				fd:        pair.fd,
+				family:    kind.family,
+				sockType:  uint32(msg.SockType),
+				laddr:     Addr{IP: name},
+				pid:       pair.pid,
+				status:    "NONE",
+				path:      name,
+				peerInode: peerInode,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// unixDiagPeerInodes dumps every AF_UNIX socket via UNIX_DIAG with
+// UDIAG_SHOW_PEER and returns a map from a socket's own inode to its
+// connected peer's inode. Sockets with no peer (listening, unconnected)
+// are omitted.
+func unixDiagPeerInodes() (map[uint32]uint32, error) {
+	fd, err := openSockDiagSocket()
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	req := unixDiagReq{
+		Family:  syscall.AF_UNIX,
+		States:  0xffffffff,
+		Show:    udiagShowPeer,
+		Cookie0: 0xffffffff,
+		Cookie1: 0xffffffff,
+	}
+	if err := sendNlmsgDump(fd, sockDiagByFamily, marshalUnixDiagReq(&req)); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[uint32]uint32)
+	err = recvNlmsgDump(fd, func(data []byte) error {
+		msg, attrs, err := parseUnixDiagMsg(data)
+		if err != nil {
+			return nil
+		}
+		_, peerInode := parseUnixDiagAttrs(attrs)
+		if peerInode != 0 {
+			ret[msg.Inode] = peerInode
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// parseUnixDiagAttrs walks the UDIAG_SHOW_* rtattr list appended after a
+// unix_diag_msg, returning the socket's bound name (if any) and its peer's
+// inode (if UDIAG_SHOW_PEER was requested and the socket is connected).
+func parseUnixDiagAttrs(attrs []byte) (name string, peerInode uint32) {
+	for len(attrs) >= 4 {
+		attrLen := int(binary.LittleEndian.Uint16(attrs[0:2]))
+		attrType := binary.LittleEndian.Uint16(attrs[2:4])
+		if attrLen < 4 || attrLen > len(attrs) {
+			break
+		}
+		value := attrs[4:attrLen]
+		switch attrType {
+		case unixDiagName:
+			name = string(value)
+		case unixDiagPeer:
+			if len(value) >= 4 {
+				peerInode = binary.LittleEndian.Uint32(value)
+			}
+		}
+		advance := (attrLen + 3) &^ 3 // rtattrs are 4-byte aligned
+		if advance == 0 || advance > len(attrs) {
+			break
+		}
+		attrs = attrs[advance:]
+	}
+	return name, peerInode
+}
+
+// diagAddr decodes the fixed 16-byte src/dst fields of inet_diag_sockid.
+// IPv4 addresses occupy the first 4 bytes; IPv6 addresses use all 16.
+func diagAddr(family uint32, raw [16]byte, portRaw [2]byte) Addr {
+	port := uint32(portRaw[0])<<8 | uint32(portRaw[1])
+	if family == syscall.AF_INET {
+		return Addr{
+			IP:   fmt.Sprintf("%d.%d.%d.%d", raw[0], raw[1], raw[2], raw[3]),
+			Port: port,
+		}
+	}
+	ip := make([]byte, 16)
+	copy(ip, raw[:])
+	return Addr{IP: net.IP(ip).String(), Port: port}
+}
+
+func marshalInetDiagReqV2(req *inetDiagReqV2) []byte {
+	buf := make([]byte, sizeofInetDiagReqV2)
+	buf[0] = req.Family
+	buf[1] = req.Protocol
+	buf[2] = req.Ext
+	buf[3] = req.Pad
+	binary.LittleEndian.PutUint32(buf[4:8], req.States)
+	copy(buf[8:10], req.ID.SPort[:])
+	copy(buf[10:12], req.ID.DPort[:])
+	copy(buf[12:28], req.ID.Src[:])
+	copy(buf[28:44], req.ID.Dst[:])
+	binary.LittleEndian.PutUint32(buf[44:48], req.ID.If)
+	binary.LittleEndian.PutUint32(buf[48:52], req.ID.Cookie[0])
+	binary.LittleEndian.PutUint32(buf[52:56], req.ID.Cookie[1])
+	return buf
+}
+
+func marshalUnixDiagReq(req *unixDiagReq) []byte {
+	buf := make([]byte, 24)
+	buf[0] = req.Family
+	buf[1] = req.Protocol
+	binary.LittleEndian.PutUint32(buf[4:8], req.States)
+	binary.LittleEndian.PutUint32(buf[8:12], req.Ino)
+	binary.LittleEndian.PutUint32(buf[12:16], req.Show)
+	binary.LittleEndian.PutUint32(buf[16:20], req.Cookie0)
+	binary.LittleEndian.PutUint32(buf[20:24], req.Cookie1)
+	return buf
+}
+
+func parseInetDiagMsg(data []byte) (*inetDiagMsg, error) {
+	if len(data) < sizeofInetDiagMsg {
+		return nil, fmt.Errorf("short inet_diag_msg: %d bytes", len(data))
+	}
+	msg := &inetDiagMsg{
+		Family:  data[0],
+		State:   data[1],
+		Timer:   data[2],
+		Retrans: data[3],
+	}
+	copy(msg.ID.SPort[:], data[4:6])
+	copy(msg.ID.DPort[:], data[6:8])
+	copy(msg.ID.Src[:], data[8:24])
+	copy(msg.ID.Dst[:], data[24:40])
+	msg.ID.If = binary.LittleEndian.Uint32(data[40:44])
+	// data[44:52] is idiag_cookie, an opaque 8-byte value we don't use.
+	msg.Expires = binary.LittleEndian.Uint32(data[52:56])
+	msg.RQueue = binary.LittleEndian.Uint32(data[56:60])
+	msg.WQueue = binary.LittleEndian.Uint32(data[60:64])
+	msg.UID = binary.LittleEndian.Uint32(data[64:68])
+	msg.Inode = binary.LittleEndian.Uint32(data[68:72])
+	return msg, nil
+}
+
+func parseUnixDiagMsg(data []byte) (*unixDiagMsg, []byte, error) {
+	if len(data) < 16 {
+		return nil, nil, fmt.Errorf("short unix_diag_msg: %d bytes", len(data))
+	}
+	msg := &unixDiagMsg{
+		Family:   data[0],
+		SockType: data[1],
+		State:    data[2],
+		Pad:      data[3],
+		Inode:    binary.LittleEndian.Uint32(data[4:8]),
+		Cookie0:  binary.LittleEndian.Uint32(data[8:12]),
+		Cookie1:  binary.LittleEndian.Uint32(data[12:16]),
+	}
+	return msg, data[16:], nil
+}